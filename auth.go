@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+/* --------------------------------------------------------------------
+   Pluggable auth backends
+
+   Auth is the contract every authorization backend implements. The
+   backend in use is selected once at startup by the scheme of
+   AUTH_BACKEND (see newAuth below) and authTransport.RoundTrip
+   delegates every incoming request to it instead of hardcoding a call
+   to an external auth service.
+-------------------------------------------------------------------- */
+
+// Auth decides whether r may proceed to the upstream. headers, when
+// non-nil, are candidates for AUTH_FORWARD_AUTH_HEADERS and are merged
+// into the upstream request the same way a response from AUTH_ENDPOINT
+// always was. status is the HTTP status returned to the client when it
+// is not http.StatusOK; err is reserved for transport-level failures
+// (the auth backend itself could not be reached/evaluated).
+type Auth interface {
+	Validate(r *http.Request) (headers http.Header, status int, err error)
+}
+
+var (
+	authBackendURL = env("AUTH_BACKEND", "") // empty → legacy AUTH_ENDPOINT-only behaviour
+	auth           Auth                      // selected backend, built once in init()
+)
+
+func init() {
+	a, err := newAuth(authBackendURL)
+	if err != nil {
+		log.Fatalf("invalid AUTH_BACKEND %q: %v", authBackendURL, err)
+	}
+	auth = a
+}
+
+// newAuth builds the Auth backend selected by the scheme of raw. An
+// empty raw preserves the pre-AUTH_BACKEND behaviour of always calling
+// AUTH_ENDPOINT over HTTP.
+func newAuth(raw string) (Auth, error) {
+	if strings.TrimSpace(raw) == "" {
+		return newHTTPAuth(authEndpoint, authMethod), nil
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parsing AUTH_BACKEND: %w", err)
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		return newHTTPAuth(raw, authMethod), nil
+	case "basicfile":
+		return newHtpasswdAuth(u.Path)
+	case "static":
+		return newStaticAuth(u.Query())
+	case "jwt":
+		return newJWTAuth(u.Query())
+	case "none":
+		return noneAuth{}, nil
+	default:
+		return nil, fmt.Errorf("unknown auth backend scheme %q", u.Scheme)
+	}
+}
+
+/* --------------------------------------------------------------------
+   http:// / https:// – call out to an external auth service
+   (this is the proxy's original, and still default, behaviour)
+-------------------------------------------------------------------- */
+
+type httpAuth struct {
+	endpoint string
+	method   string
+	timeout  time.Duration
+	retries  int
+	backoff  time.Duration
+	failMode string
+	cb       *circuitBreaker
+}
+
+func newHTTPAuth(endpoint, method string) *httpAuth {
+	return &httpAuth{
+		endpoint: endpoint,
+		method:   method,
+		timeout:  authTimeout,
+		retries:  authRetries,
+		backoff:  authRetryBackoff,
+		failMode: authFailMode,
+		cb:       newCircuitBreaker(cbWindow, cbMinRequests, cbFailureRatio, cbCooldown),
+	}
+}
+
+func (a *httpAuth) Validate(r *http.Request) (http.Header, int, error) {
+	if !a.cb.Allow() {
+		logger.Warn("auth circuit breaker open, short-circuiting", "endpoint", a.endpoint, "fail_mode", a.failMode)
+		recordAuthBackendResult(false)
+		return a.fallback()
+	}
+
+	// Every return below here has consumed this Allow() admission (the
+	// half-open probe, if this was one) and must resolve the circuit
+	// breaker / readiness signal exactly once, or a half-open breaker
+	// wedges open forever and /readyz never recovers. reachable defaults
+	// to true: a client-side failure (oversized upload, a local
+	// body-read error) never even reaches the auth backend, so it says
+	// nothing about whether that backend is up.
+	reachable := true
+	defer func() {
+		a.cb.Record(reachable)
+		recordAuthBackendResult(reachable)
+	}()
+
+	// AUTH_BODY_MODE=headers-only: never touch r.Body, so it streams
+	// straight through to upstream untouched.
+	if authBodyMode == bodyModeHeadersOnly {
+		headers, status, err := a.callWithRetry(r, nil, "")
+		reachable = err == nil && status < http.StatusInternalServerError
+		return a.resolve(headers, status, err)
+	}
+
+	tee, tooLarge, err := newBodyTee(r, int64(maxBodySize)<<20)
+	if err != nil {
+		return nil, 0, err
+	}
+	if tooLarge {
+		return nil, http.StatusRequestEntityTooLarge, nil
+	}
+
+	// Get the upstream-bound reader now; this is what r.Clone() downstream
+	// forwards to UPSTREAM_ADDR, independent of whatever callWithRetry
+	// below does with the auth side.
+	upstreamBody, err := tee.Reader()
+	if err != nil {
+		tee.Close()
+		return nil, 0, err
+	}
+	r.Body = toReadCloser(upstreamBody)
+
+	var bodySource func() (io.ReadSeeker, error)
+	sha := ""
+	if authBodyMode == bodyModeHash {
+		sha = tee.SHA256Hex()
+	} else {
+		bodySource = tee.Reader
+	}
+
+	// callWithRetry reopens bodySource fresh for every attempt, so the
+	// tee must stay open until all attempts are done.
+	headers, status, err := a.callWithRetry(r, bodySource, sha)
+	tee.Close()
+	reachable = err == nil && status < http.StatusInternalServerError
+	return a.resolve(headers, status, err)
+}
+
+// resolve converts a failed call into AUTH_FAIL_MODE's deny/allow
+// decision rather than surfacing the raw transport error to the client.
+// Circuit breaker / readiness bookkeeping lives in Validate's defer,
+// not here, so it still runs for the exit paths that never reach a call
+// at all (oversized body, a local read error).
+func (a *httpAuth) resolve(headers http.Header, status int, err error) (http.Header, int, error) {
+	if err != nil {
+		logger.Warn("auth backend unreachable", "endpoint", a.endpoint, "error", err)
+		return a.fallback()
+	}
+	return headers, status, nil
+}
+
+// fallback produces AUTH_FAIL_MODE's synthesized decision for when the
+// backend can't be consulted (circuit open, or the call itself
+// failed). It's marked Cache-Control: no-store so validateAuth's cache
+// never stores it: a cached fail-open 200 would keep letting requests
+// through (or a cached 503 keep denying them) for up to AUTH_CACHE_TTL
+// after the real backend has already recovered and the breaker closed.
+func (a *httpAuth) fallback() (http.Header, int, error) {
+	h := http.Header{"Cache-Control": {"no-store"}}
+	if a.failMode == "allow" {
+		authFailOpenTotal.Inc()
+		return h, http.StatusOK, nil
+	}
+	return h, http.StatusServiceUnavailable, nil
+}
+
+// callWithRetry retries call on network errors and 5xx responses, up to
+// a.retries times, with jittered exponential backoff. bodySource, when
+// non-nil, is called before every attempt (including the first) to get
+// a fresh io.ReadSeeker to send. It's reopened rather than rewound
+// because net/http closes the request body after each RoundTrip, and a
+// spilled-to-disk body's reader can't be seeked again once closed.
+func (a *httpAuth) callWithRetry(r *http.Request, bodySource func() (io.ReadSeeker, error), sha string) (http.Header, int, error) {
+	var headers http.Header
+	var status int
+	var err error
+
+	for attempt := 0; attempt <= a.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(retryDelay(a.backoff, attempt))
+		}
+
+		var body io.ReadSeeker
+		if bodySource != nil {
+			if body, err = bodySource(); err != nil {
+				return nil, 0, err
+			}
+		}
+
+		headers, status, err = a.call(r, body, sha)
+		if !retryable(err, status) {
+			return headers, status, err
+		}
+	}
+	return headers, status, err
+}
+
+// call performs a single HTTP round trip to the auth endpoint, bounded
+// by AUTH_TIMEOUT. body is the request body to send (nil for
+// AUTH_BODY_MODE=headers-only/hash); sha, when non-empty, is sent as
+// X-Body-Sha256 instead (AUTH_BODY_MODE=hash).
+func (a *httpAuth) call(r *http.Request, body io.Reader, sha string) (http.Header, int, error) {
+	if body == nil {
+		body = http.NoBody
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), a.timeout)
+	defer cancel()
+
+	authReq, err := http.NewRequestWithContext(ctx, a.method, a.endpoint, body)
+	if err != nil {
+		return nil, 0, err
+	}
+	authReq.Header = cloneSubset(r.Header)
+	authReq.Header.Set("X-Orig-Uri", r.URL.RequestURI())
+	authReq.Header.Set("X-Orig-Method", r.Method)
+	if sha != "" {
+		authReq.Header.Set("X-Body-Sha256", sha)
+	}
+	stripHopByHop(authReq.Header)
+
+	resp, err := http.DefaultTransport.RoundTrip(authReq)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer drainAndClose(resp.Body)
+
+	return resp.Header.Clone(), resp.StatusCode, nil
+}
+
+// toReadCloser adapts an io.ReadSeeker for use as an http.Request body,
+// preserving it as-is when it already implements io.Closer (e.g. the
+// spill file reopened by bodyTee.Reader) so the transport can close it
+// once the body has been sent.
+func toReadCloser(rs io.ReadSeeker) io.ReadCloser {
+	if rc, ok := rs.(io.ReadCloser); ok {
+		return rc
+	}
+	return io.NopCloser(rs)
+}
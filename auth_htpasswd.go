@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tg123/go-htpasswd"
+)
+
+/* --------------------------------------------------------------------
+   basicfile:// - local htpasswd file (bcrypt/SHA/MD5), hot-reloaded
+   whenever its mtime changes.
+-------------------------------------------------------------------- */
+
+type htpasswdAuth struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	file    *htpasswd.File
+}
+
+func newHtpasswdAuth(path string) (*htpasswdAuth, error) {
+	a := &htpasswdAuth{path: path}
+	if err := a.reload(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// reload re-parses the htpasswd file if it changed on disk since the
+// last successful load.
+func (a *htpasswdAuth) reload() error {
+	fi, err := os.Stat(a.path)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file != nil && fi.ModTime().Equal(a.modTime) {
+		return nil
+	}
+
+	f, err := htpasswd.New(a.path, htpasswd.DefaultSystems, nil)
+	if err != nil {
+		return err
+	}
+	a.file = f
+	a.modTime = fi.ModTime()
+	return nil
+}
+
+func (a *htpasswdAuth) Validate(r *http.Request) (http.Header, int, error) {
+	if err := a.reload(); err != nil {
+		return nil, 0, err
+	}
+
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		return nil, http.StatusUnauthorized, nil
+	}
+
+	a.mu.Lock()
+	f := a.file
+	a.mu.Unlock()
+
+	if !f.Match(user, pass) {
+		return nil, http.StatusUnauthorized, nil
+	}
+
+	h := http.Header{}
+	h.Set("X-Auth-User", user)
+	return h, http.StatusOK, nil
+}
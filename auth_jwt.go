@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/MicahParks/keyfunc/v3"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+/* --------------------------------------------------------------------
+   jwt:// - verify a bearer token against a cached JWKS, optionally
+   checking issuer and audience.
+-------------------------------------------------------------------- */
+
+type jwtAuth struct {
+	iss string
+	aud string
+	kf  keyfunc.Keyfunc
+}
+
+func newJWTAuth(q url.Values) (*jwtAuth, error) {
+	jwksURL := q.Get("jwks_url")
+	if jwksURL == "" {
+		return nil, fmt.Errorf("jwt backend requires a jwks_url query parameter")
+	}
+
+	kf, err := keyfunc.NewDefaultCtx(nil, []string{jwksURL})
+	if err != nil {
+		return nil, fmt.Errorf("fetching JWKS from %q: %w", jwksURL, err)
+	}
+
+	return &jwtAuth{iss: q.Get("iss"), aud: q.Get("aud"), kf: kf}, nil
+}
+
+func (a *jwtAuth) Validate(r *http.Request) (http.Header, int, error) {
+	bearer := r.Header.Get("Authorization")
+	raw, ok := strings.CutPrefix(bearer, "Bearer ")
+	if !ok || raw == "" {
+		return nil, http.StatusUnauthorized, nil
+	}
+
+	claims := jwt.MapClaims{}
+	tok, err := jwt.ParseWithClaims(raw, claims, a.kf.Keyfunc)
+	if err != nil || !tok.Valid {
+		return nil, http.StatusUnauthorized, nil
+	}
+
+	if a.iss != "" {
+		if iss, _ := claims.GetIssuer(); iss != a.iss {
+			return nil, http.StatusUnauthorized, nil
+		}
+	}
+	if a.aud != "" {
+		aud, _ := claims.GetAudience()
+		if !audienceContains(aud, a.aud) {
+			return nil, http.StatusUnauthorized, nil
+		}
+	}
+
+	h := http.Header{}
+	if sub, _ := claims.GetSubject(); sub != "" {
+		h.Set("X-Auth-Subject", sub)
+	}
+	// Surface string-valued claims as X-Claim-<Name> so AUTH_POLICY_FILE
+	// rules can gate on required_claims.
+	for name, v := range claims {
+		if s, ok := v.(string); ok {
+			h.Set("X-Claim-"+name, s)
+		}
+	}
+	return h, http.StatusOK, nil
+}
+
+func audienceContains(aud jwt.ClaimStrings, want string) bool {
+	for _, a := range aud {
+		if a == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+)
+
+/* --------------------------------------------------------------------
+   static:// - fixed username/password, mostly useful for local
+   development and smoke tests.
+
+   none:// - never challenge, forward everything. Lets operators run
+   the proxy purely for its routing/body-handling behaviour.
+-------------------------------------------------------------------- */
+
+type staticAuth struct {
+	username string
+	password string
+}
+
+func newStaticAuth(q url.Values) (*staticAuth, error) {
+	return &staticAuth{username: q.Get("username"), password: q.Get("password")}, nil
+}
+
+func (a *staticAuth) Validate(r *http.Request) (http.Header, int, error) {
+	user, pass, ok := r.BasicAuth()
+	if !ok || user != a.username || pass != a.password {
+		return nil, http.StatusUnauthorized, nil
+	}
+	return nil, http.StatusOK, nil
+}
+
+type noneAuth struct{}
+
+func (noneAuth) Validate(*http.Request) (http.Header, int, error) {
+	return nil, http.StatusOK, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestHTTPAuthValidateResolvesBreakerOnTooLarge guards against a
+// regression where an early return (tooLarge, or a body-read error)
+// skipped the circuit breaker bookkeeping entirely: if that return
+// happened to be the admitted half-open probe, the breaker would stay
+// stuck in cbHalfOpen and every later request would be rejected by
+// Allow() forever.
+func TestHTTPAuthValidateResolvesBreakerOnTooLarge(t *testing.T) {
+	origMax := maxBodySize
+	maxBodySize = 0
+	defer func() { maxBodySize = origMax }()
+
+	a := newHTTPAuth("http://127.0.0.1:0/unused", "POST")
+	a.cb = newCircuitBreaker(time.Minute, 1, 0.5, 10*time.Millisecond)
+
+	a.cb.Record(false) // trip the breaker open
+	if a.cb.state != cbOpen {
+		t.Fatalf("state = %d, want cbOpen", a.cb.state)
+	}
+	time.Sleep(15 * time.Millisecond)
+
+	r := httptest.NewRequest("POST", "/", bytes.NewReader([]byte("too big for a 0 MB cap")))
+	_, status, err := a.Validate(r)
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if status != 413 {
+		t.Fatalf("status = %d, want 413", status)
+	}
+	if a.cb.state == cbHalfOpen {
+		t.Fatal("breaker stuck in cbHalfOpen after the tooLarge exit path resolved the probe")
+	}
+
+	// The breaker must admit calls again — a wedged half-open breaker
+	// would reject every subsequent request regardless of AUTH_FAIL_MODE.
+	if !a.cb.Allow() {
+		t.Fatal("expected the breaker to admit calls after the probe was resolved")
+	}
+}
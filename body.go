@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+)
+
+/* --------------------------------------------------------------------
+   Streaming body capture.
+
+   RoundTrip used to do io.ReadAll(io.LimitReader(...)) before calling
+   auth, which buffers the whole body in memory (OOM-prone under
+   concurrent uploads) and silently drops anything past the limit.
+   bodyTee instead buffers only up to bodySpillThreshold in memory and
+   spills the rest to a temp file (see body_linux.go / body_other.go),
+   exposing independent io.ReadSeekers so the same body can be replayed
+   to both the auth call and the upstream request. AUTH_BODY_MODE
+   controls how much of it the auth backend actually sees.
+-------------------------------------------------------------------- */
+
+const bodySpillThreshold = 1 << 20 // 1 MiB kept in memory before spilling
+
+const (
+	bodyModeFull        = "full"         // send the whole body to auth (default, current behaviour)
+	bodyModeHash        = "hash"         // send only method+path+SHA256(body) to auth
+	bodyModeHeadersOnly = "headers-only" // never send/read the body for auth
+)
+
+var authBodyMode = env("AUTH_BODY_MODE", bodyModeFull)
+
+// spillFile is the platform-specific half of bodyTee: where the spilled
+// bytes actually live once they outgrow memory.
+type spillFile interface {
+	io.Writer
+	io.Closer
+	// Reopen returns an independent io.ReadSeeker over everything
+	// written so far, positioned at the start.
+	Reopen() (io.ReadSeeker, error)
+}
+
+type bodyTee struct {
+	mem   []byte
+	spill spillFile
+	sum   [sha256.Size]byte
+	size  int64
+}
+
+// newBodyTee drains r.Body into a bodyTee, enforcing maxBytes as a hard
+// cap. tooLarge is true when the client sent more than that; callers
+// must respond 413 rather than silently truncate.
+func newBodyTee(r *http.Request, maxBytes int64) (t *bodyTee, tooLarge bool, err error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return &bodyTee{}, false, nil
+	}
+	defer r.Body.Close()
+
+	t = &bodyTee{}
+	h := sha256.New()
+	buf := make([]byte, 32*1024)
+	for {
+		n, rerr := r.Body.Read(buf)
+		if n > 0 {
+			if t.size+int64(n) > maxBytes {
+				t.Close()
+				return nil, true, nil
+			}
+			h.Write(buf[:n])
+			if werr := t.append(buf[:n]); werr != nil {
+				t.Close()
+				return nil, false, werr
+			}
+			t.size += int64(n)
+		}
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			t.Close()
+			return nil, false, rerr
+		}
+	}
+	copy(t.sum[:], h.Sum(nil))
+	return t, false, nil
+}
+
+func (t *bodyTee) append(p []byte) error {
+	if t.spill == nil && int64(len(t.mem))+int64(len(p)) <= bodySpillThreshold {
+		t.mem = append(t.mem, p...)
+		return nil
+	}
+	if t.spill == nil {
+		sf, err := newSpillFile()
+		if err != nil {
+			return err
+		}
+		if len(t.mem) > 0 {
+			if _, err := sf.Write(t.mem); err != nil {
+				sf.Close()
+				return err
+			}
+			t.mem = nil
+		}
+		t.spill = sf
+	}
+	_, err := t.spill.Write(p)
+	return err
+}
+
+// Reader returns a fresh, independent io.ReadSeeker over the captured
+// body, starting from the beginning. Safe to call more than once, as
+// long as it's called before Close.
+func (t *bodyTee) Reader() (io.ReadSeeker, error) {
+	if t.spill != nil {
+		return t.spill.Reopen()
+	}
+	return bytes.NewReader(t.mem), nil
+}
+
+func (t *bodyTee) SHA256Hex() string { return hex.EncodeToString(t.sum[:]) }
+
+// Close releases the spill file. Safe to call once all Readers needed
+// have already been obtained.
+func (t *bodyTee) Close() error {
+	if t.spill != nil {
+		return t.spill.Close()
+	}
+	return nil
+}
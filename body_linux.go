@@ -0,0 +1,44 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+/* --------------------------------------------------------------------
+   Linux spill: O_TMPFILE has no directory entry, so the kernel frees
+   it the instant every fd referencing it is closed - no cleanup code
+   needed even if the process is killed mid-request.
+-------------------------------------------------------------------- */
+
+type linuxSpillFile struct{ f *os.File }
+
+func newSpillFile() (spillFile, error) {
+	f, err := os.OpenFile(os.TempDir(), os.O_RDWR|unix.O_TMPFILE, 0600)
+	if err != nil {
+		// Some filesystems (overlayfs, certain tmpfs configs) don't
+		// support O_TMPFILE; fall back to an unlinked regular file.
+		f, err = os.CreateTemp("", "auth-proxy-body-*")
+		if err != nil {
+			return nil, err
+		}
+		os.Remove(f.Name())
+	}
+	return &linuxSpillFile{f: f}, nil
+}
+
+func (s *linuxSpillFile) Write(p []byte) (int, error) { return s.f.Write(p) }
+
+func (s *linuxSpillFile) Close() error { return s.f.Close() }
+
+// Reopen dups the descriptor through /proc/self/fd so the returned
+// reader has its own seek position, independent of the writer and of
+// any other reader obtained the same way.
+func (s *linuxSpillFile) Reopen() (io.ReadSeeker, error) {
+	return os.Open(fmt.Sprintf("/proc/self/fd/%d", s.f.Fd()))
+}
@@ -0,0 +1,38 @@
+//go:build !linux
+
+package main
+
+import (
+	"io"
+	"os"
+)
+
+/* --------------------------------------------------------------------
+   Fallback spill for non-Linux builds: a regular temp file, removed
+   once the spill is closed (no O_TMPFILE outside Linux).
+-------------------------------------------------------------------- */
+
+type genericSpillFile struct {
+	f    *os.File
+	path string
+}
+
+func newSpillFile() (spillFile, error) {
+	f, err := os.CreateTemp("", "auth-proxy-body-*")
+	if err != nil {
+		return nil, err
+	}
+	return &genericSpillFile{f: f, path: f.Name()}, nil
+}
+
+func (s *genericSpillFile) Write(p []byte) (int, error) { return s.f.Write(p) }
+
+func (s *genericSpillFile) Close() error {
+	err := s.f.Close()
+	os.Remove(s.path)
+	return err
+}
+
+func (s *genericSpillFile) Reopen() (io.ReadSeeker, error) {
+	return os.Open(s.path)
+}
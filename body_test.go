@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTeeRequest(t *testing.T, body []byte) *http.Request {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	return r
+}
+
+func readAll(t *testing.T, rs io.ReadSeeker) []byte {
+	t.Helper()
+	b, err := io.ReadAll(rs)
+	if err != nil {
+		t.Fatalf("reading: %v", err)
+	}
+	return b
+}
+
+func TestBodyTeeStaysInMemoryBelowThreshold(t *testing.T) {
+	body := bytes.Repeat([]byte("a"), 1024)
+	tee, tooLarge, err := newBodyTee(newTeeRequest(t, body), int64(bodySpillThreshold)*10)
+	if err != nil {
+		t.Fatalf("newBodyTee: %v", err)
+	}
+	if tooLarge {
+		t.Fatal("did not expect tooLarge")
+	}
+	defer tee.Close()
+
+	if tee.spill != nil {
+		t.Fatal("expected a small body to stay in memory, not spill")
+	}
+
+	rs, err := tee.Reader()
+	if err != nil {
+		t.Fatalf("Reader: %v", err)
+	}
+	if got := readAll(t, rs); !bytes.Equal(got, body) {
+		t.Fatalf("Reader content mismatch: got %d bytes, want %d", len(got), len(body))
+	}
+
+	sum := sha256.Sum256(body)
+	if got := tee.SHA256Hex(); got != hex.EncodeToString(sum[:]) {
+		t.Fatalf("SHA256Hex = %q, want %q", got, hex.EncodeToString(sum[:]))
+	}
+}
+
+func TestBodyTeeSpillsPastThreshold(t *testing.T) {
+	body := bytes.Repeat([]byte("b"), bodySpillThreshold+4096)
+	tee, tooLarge, err := newBodyTee(newTeeRequest(t, body), int64(len(body))*2)
+	if err != nil {
+		t.Fatalf("newBodyTee: %v", err)
+	}
+	if tooLarge {
+		t.Fatal("did not expect tooLarge")
+	}
+	defer tee.Close()
+
+	if tee.spill == nil {
+		t.Fatal("expected a body past bodySpillThreshold to spill to disk")
+	}
+
+	// Independent readers, both over the full spilled content.
+	r1, err := tee.Reader()
+	if err != nil {
+		t.Fatalf("Reader (1): %v", err)
+	}
+	r2, err := tee.Reader()
+	if err != nil {
+		t.Fatalf("Reader (2): %v", err)
+	}
+	got1, got2 := readAll(t, r1), readAll(t, r2)
+	if !bytes.Equal(got1, body) {
+		t.Fatalf("first reader: got %d bytes, want %d", len(got1), len(body))
+	}
+	if !bytes.Equal(got2, body) {
+		t.Fatalf("second reader: got %d bytes, want %d", len(got2), len(body))
+	}
+
+	sum := sha256.Sum256(body)
+	if got := tee.SHA256Hex(); got != hex.EncodeToString(sum[:]) {
+		t.Fatalf("SHA256Hex = %q, want %q", got, hex.EncodeToString(sum[:]))
+	}
+}
+
+func TestBodyTeeTooLargeReturnsNoTee(t *testing.T) {
+	body := bytes.Repeat([]byte("c"), 2048)
+	tee, tooLarge, err := newBodyTee(newTeeRequest(t, body), 1024)
+	if err != nil {
+		t.Fatalf("newBodyTee: %v", err)
+	}
+	if !tooLarge {
+		t.Fatal("expected tooLarge for a body exceeding maxBytes")
+	}
+	if tee != nil {
+		t.Fatal("expected a nil tee when tooLarge")
+	}
+}
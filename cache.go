@@ -0,0 +1,177 @@
+package main
+
+import (
+	"container/list"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* --------------------------------------------------------------------
+   Auth decision cache
+
+   Repeated calls within a short window (e.g. the same signed request
+   retried, or a hot JWT hitting the proxy many times a second) don't
+   need to hit the auth backend again. Entries are keyed by method +
+   path + a configurable projection of headers, and store both the
+   decision and the headers that would have been forwarded to upstream
+   so a hit can be replayed without re-validating.
+-------------------------------------------------------------------- */
+
+var (
+	authCacheSize   = envInt("AUTH_CACHE_SIZE", 0) // 0 → caching disabled
+	authCacheTTL    = envDuration("AUTH_CACHE_TTL", 5*time.Second)
+	authCacheNegTTL = envDuration("AUTH_CACHE_NEG_TTL", 1*time.Second)
+	authCacheKeyHdr = parseHeaderList(env("AUTH_CACHE_KEY_HEADERS", "Signature,Authorization"))
+
+	authCache *decisionCache
+)
+
+func init() {
+	if authCacheSize > 0 {
+		authCache = newDecisionCache(authCacheSize)
+	}
+}
+
+type cacheEntry struct {
+	headers   http.Header
+	status    int
+	expiresAt time.Time
+}
+
+// decisionCache is a bounded, thread-safe LRU of cacheEntry.
+type decisionCache struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type cacheItem struct {
+	key   string
+	entry cacheEntry
+}
+
+func newDecisionCache(size int) *decisionCache {
+	return &decisionCache{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element, size),
+	}
+}
+
+func (c *decisionCache) get(key string) (cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return cacheEntry{}, false
+	}
+	it := el.Value.(*cacheItem)
+	if time.Now().After(it.entry.expiresAt) {
+		c.ll.Remove(el)
+		delete(c.items, key)
+		return cacheEntry{}, false
+	}
+	c.ll.MoveToFront(el)
+	return it.entry, true
+}
+
+func (c *decisionCache) set(key string, entry cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		el.Value.(*cacheItem).entry = entry
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	el := c.ll.PushFront(&cacheItem{key: key, entry: entry})
+	c.items[key] = el
+
+	for c.ll.Len() > c.size {
+		oldest := c.ll.Back()
+		if oldest == nil {
+			break
+		}
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheItem).key)
+	}
+}
+
+func (c *decisionCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// cacheKey projects r onto the configured key headers.
+func cacheKey(r *http.Request) string {
+	var b strings.Builder
+	b.WriteString(r.Method)
+	b.WriteByte(' ')
+	b.WriteString(r.URL.Path)
+	for _, h := range authCacheKeyHdr {
+		b.WriteByte('\x00')
+		b.WriteString(h)
+		b.WriteByte('=')
+		b.WriteString(r.Header.Get(h))
+	}
+	return b.String()
+}
+
+// validateAuth wraps backend.Validate(r) with the decision cache (a
+// no-op passthrough when AUTH_CACHE_SIZE is 0).
+func validateAuth(backend Auth, r *http.Request) (http.Header, int, error) {
+	if authCache == nil {
+		return backend.Validate(r)
+	}
+
+	key := cacheKey(r)
+	if entry, ok := authCache.get(key); ok {
+		cacheHitsTotal.Inc()
+		return entry.headers, entry.status, nil
+	}
+	cacheMissTotal.Inc()
+
+	headers, status, err := backend.Validate(r)
+	if err != nil {
+		return headers, status, err
+	}
+
+	if ttl, store := cacheTTL(headers, status); store {
+		authCache.set(key, cacheEntry{headers: headers.Clone(), status: status, expiresAt: time.Now().Add(ttl)})
+	}
+	return headers, status, nil
+}
+
+// cacheTTL honors Cache-Control: no-store / max-age from the auth
+// response headers (no-store wins wherever it appears), falling back to
+// AUTH_CACHE_TTL / AUTH_CACHE_NEG_TTL depending on whether status was a 2xx.
+func cacheTTL(headers http.Header, status int) (ttl time.Duration, store bool) {
+	cc := headers.Get("Cache-Control")
+	maxAge, haveMaxAge := 0, false
+	for _, directive := range strings.Split(cc, ",") {
+		directive = strings.TrimSpace(directive)
+		if strings.EqualFold(directive, "no-store") {
+			return 0, false
+		}
+		if v, ok := strings.CutPrefix(strings.ToLower(directive), "max-age="); ok && !haveMaxAge {
+			if secs, err := strconv.Atoi(v); err == nil {
+				maxAge, haveMaxAge = secs, true
+			}
+		}
+	}
+	if haveMaxAge {
+		return time.Duration(maxAge) * time.Second, maxAge > 0
+	}
+
+	if status >= 200 && status < 300 {
+		return authCacheTTL, authCacheTTL > 0
+	}
+	return authCacheNegTTL, authCacheNegTTL > 0
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCacheTTL(t *testing.T) {
+	cases := []struct {
+		name      string
+		headers   http.Header
+		status    int
+		wantStore bool
+		wantTTL   time.Duration
+	}{
+		{
+			name:      "no-store overrides everything",
+			headers:   http.Header{"Cache-Control": {"no-store, max-age=60"}},
+			status:    http.StatusOK,
+			wantStore: false,
+		},
+		{
+			name:      "max-age wins over defaults",
+			headers:   http.Header{"Cache-Control": {"max-age=30"}},
+			status:    http.StatusOK,
+			wantStore: true,
+			wantTTL:   30 * time.Second,
+		},
+		{
+			name:      "max-age=0 disables caching",
+			headers:   http.Header{"Cache-Control": {"max-age=0"}},
+			status:    http.StatusOK,
+			wantStore: false,
+		},
+		{
+			name:      "2xx falls back to AUTH_CACHE_TTL",
+			headers:   http.Header{},
+			status:    http.StatusOK,
+			wantStore: true,
+			wantTTL:   authCacheTTL,
+		},
+		{
+			name:      "non-2xx falls back to AUTH_CACHE_NEG_TTL",
+			headers:   http.Header{},
+			status:    http.StatusForbidden,
+			wantStore: true,
+			wantTTL:   authCacheNegTTL,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ttl, store := cacheTTL(tc.headers, tc.status)
+			if store != tc.wantStore {
+				t.Fatalf("store = %v, want %v", store, tc.wantStore)
+			}
+			if store && ttl != tc.wantTTL {
+				t.Fatalf("ttl = %v, want %v", ttl, tc.wantTTL)
+			}
+		})
+	}
+}
+
+func TestHTTPAuthFallbackIsNotCacheable(t *testing.T) {
+	allow := &httpAuth{failMode: "allow"}
+	headers, status, err := allow.fallback()
+	if err != nil {
+		t.Fatalf("fallback: %v", err)
+	}
+	if status != http.StatusOK {
+		t.Fatalf("status = %d, want 200 for failMode=allow", status)
+	}
+	if _, store := cacheTTL(headers, status); store {
+		t.Fatal("expected a fail-open fallback decision not to be cached")
+	}
+
+	deny := &httpAuth{failMode: "deny"}
+	headers, status, err = deny.fallback()
+	if err != nil {
+		t.Fatalf("fallback: %v", err)
+	}
+	if status != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503 for failMode=deny", status)
+	}
+	if _, store := cacheTTL(headers, status); store {
+		t.Fatal("expected a deny fallback decision not to be cached")
+	}
+}
+
+func TestDecisionCacheLRUEviction(t *testing.T) {
+	c := newDecisionCache(2)
+
+	entry := func(status int) cacheEntry {
+		return cacheEntry{status: status, expiresAt: time.Now().Add(time.Minute)}
+	}
+
+	c.set("a", entry(1))
+	c.set("b", entry(2))
+	if got := c.len(); got != 2 {
+		t.Fatalf("len = %d, want 2", got)
+	}
+
+	// Touch "a" so "b" becomes the least-recently-used entry.
+	if _, ok := c.get("a"); !ok {
+		t.Fatal("expected a to be present")
+	}
+
+	c.set("c", entry(3))
+	if got := c.len(); got != 2 {
+		t.Fatalf("len after eviction = %d, want 2", got)
+	}
+	if _, ok := c.get("b"); ok {
+		t.Fatal("expected b to have been evicted as least recently used")
+	}
+	if _, ok := c.get("a"); !ok {
+		t.Fatal("expected a to survive eviction")
+	}
+	if _, ok := c.get("c"); !ok {
+		t.Fatal("expected c to be present")
+	}
+}
+
+func TestDecisionCacheExpiry(t *testing.T) {
+	c := newDecisionCache(10)
+	c.set("k", cacheEntry{status: http.StatusOK, expiresAt: time.Now().Add(-time.Second)})
+
+	if _, ok := c.get("k"); ok {
+		t.Fatal("expected expired entry to be treated as a miss")
+	}
+	if got := c.len(); got != 0 {
+		t.Fatalf("len = %d, want 0 after expired entry is evicted on read", got)
+	}
+}
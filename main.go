@@ -23,7 +23,7 @@ var (
 	upstreamAddr            = env("UPSTREAM_ADDR", "https://127.0.0.1:8080")
 	authEndpoint            = env("AUTH_ENDPOINT", "http://127.0.0.1:8181/v1/signature")
 	authMethod              = env("AUTH_METHOD", http.MethodPost)
-	maxBodySize             = envInt("MAX_BODY_SIZE_MB", 30)               // MB forwarded to auth
+	maxBodySize             = envInt("MAX_BODY_SIZE_MB", 30)               // hard cap (MB) on bodies an http(s) auth backend reads (AUTH_BODY_MODE full/hash, cache miss); exceeding it returns 413
 	debug                   = envBool("DEBUG", false)                      // DEBUG=1 turns on verbose logs
 	authIncludeRegex        = env("AUTH_INCLUDE_REGEX", "^/public(?:/|$)") // only URIs matching this require auth
 	forwardAuthHeadersRaw   = env("AUTH_FORWARD_AUTH_HEADERS", "")         // comma header list; empty → no Auth headers forwarding
@@ -57,17 +57,27 @@ func init() {
 func main() {
 	proxy := httputil.ReverseProxy{
 		Director:  func(*http.Request) {}, // keep original URL unchanged
-		Transport: &authTransport{http.DefaultTransport},
+		Transport: &authTransport{newUpstreamTransport()},
 		ErrorLog:  log.New(log.Writer(), "[proxy] ", log.LstdFlags),
 	}
 
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isUpgradeRequest(r) {
+			handleUpgrade(w, r)
+			return
+		}
+		proxy.ServeHTTP(w, r)
+	})
+
 	srv := &http.Server{
 		Addr:              listenAddr,
-		Handler:           &proxy,
+		Handler:           handler,
 		ReadHeaderTimeout: 5 * time.Second,
 	}
 
-	log.Printf("auth-proxy listening on %s  (→  %s)", listenAddr, upstreamAddr)
+	go startMetricsServer()
+
+	logger.Info("auth-proxy listening", "addr", listenAddr, "upstream", upstreamAddr)
 	log.Fatal(srv.ListenAndServe())
 }
 
@@ -78,60 +88,62 @@ func main() {
 type authTransport struct{ upstream http.RoundTripper }
 
 func (a *authTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	reqID := requestID(r)
+	log := logger.With("request_id", reqID, "method", r.Method, "path", r.URL.Path)
+
+	start := time.Now()
+	inFlightRequests.Inc()
+	defer inFlightRequests.Dec()
+	defer func() { totalLatency.Observe(time.Since(start).Seconds()) }()
+
+	stripAuthDerivedHeaders(r.Header)
+	backend, forwardHeaders, rule, bypass := selectAuth(r)
+	rl := ruleLabel(rule)
+
 	/* ---------- BYPASS CHECK ---------- */
-	if !authIncludeRE.MatchString(r.URL.Path) || r.Method == http.MethodOptions {
+	if bypass || r.Method == http.MethodOptions {
 		// forward directly to upstream without touching auth
 		out := r.Clone(r.Context())
 		out.URL.Scheme = upstreamURL.Scheme
 		out.URL.Host = upstreamURL.Host
 		out.Host = upstreamURL.Host
-		if debug {
-			dump("BYPASS → UPSTREAM", out, nil, "")
-		}
-		return a.upstream.RoundTrip(out)
+		stripHopByHop(out.Header)
+		log.Debug("bypassing auth")
+		return a.roundTripUpstream(out)
 	}
 
-	/* ---------- CLIENT → PROXY ---------- */
-	if debug {
-		dump("CLIENT → PROXY", r, nil, "")
-	}
+	log.Debug("validating request")
 
-	// 1) Copy/peek body so we can use it twice
-	var bodyCopy []byte
-	if r.Body != nil {
-		peek, _ := io.ReadAll(io.LimitReader(r.Body, int64(maxBodySize<<20)))
-		bodyCopy = peek
-		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(peek), r.Body))
+	// 1) A matched policy rule can deny outright, or require headers the
+	// auth backend never even gets consulted for.
+	if rule != nil && (rule.Deny || !requiredHeadersSatisfied(r, rule.RequiredHeaders)) {
+		recordAuthDecision(rl, http.StatusForbidden)
+		return denyResponse(r, http.StatusForbidden), nil
 	}
 
-	// 2) Call auth service
-	authReq, _ := http.NewRequest(authMethod, authEndpoint, bytes.NewReader(bodyCopy))
-	authReq.Header = cloneSubset(r.Header)
-	authReq.Header.Set("X-Orig-Uri", r.URL.RequestURI())
-	authReq.Header.Set("X-Orig-Method", r.Method)
-
-	if debug {
-		dump("PROXY → AUTH", authReq, nil, string(bodyCopy))
-	}
-
-	authResp, err := a.upstream.RoundTrip(authReq)
+	// 2) Delegate the allow/deny decision to the matched (or default)
+	// auth backend (AUTH_BACKEND; defaults to calling AUTH_ENDPOINT over HTTP).
+	authStart := time.Now()
+	authHeaders, status, err := validateAuth(backend, r)
+	authLatency.Observe(time.Since(authStart).Seconds())
 	if err != nil {
+		log.Error("auth backend call failed", "error", err)
 		return nil, err
 	}
-	defer drainAndClose(authResp.Body)
-
-	if debug {
-		dump("AUTH → PROXY", authReq, authResp, "")
+	if status == http.StatusOK && rule != nil && !requiredClaimsSatisfied(authHeaders, rule.RequiredClaims) {
+		status = http.StatusForbidden
 	}
+	recordAuthDecision(rl, status)
 
 	// 3) Allow / deny
-	if authResp.StatusCode != http.StatusOK {
+	if status != http.StatusOK {
+		log.Debug("auth denied request", "status", status)
 		return &http.Response{
-			StatusCode: authResp.StatusCode,
-			Status:     authResp.Status,
+			StatusCode: status,
+			Status:     http.StatusText(status),
 			Proto:      "HTTP/1.1", ProtoMajor: 1, ProtoMinor: 1,
 			Request: r,
-			Header:  authResp.Header.Clone(),
+			Header:  authHeaders.Clone(),
 			Body:    io.NopCloser(bytes.NewReader(nil)),
 		}, nil
 	}
@@ -141,59 +153,26 @@ func (a *authTransport) RoundTrip(r *http.Request) (*http.Response, error) {
 	out.URL.Scheme = upstreamURL.Scheme
 	out.URL.Host = upstreamURL.Host
 	out.Host = upstreamURL.Host
+	stripHopByHop(out.Header)
 
-	// 4a) Copy configured headers from AUTH response → upstream request (optional)
-	if len(forwardAuthHeadersCanon) > 0 {
-		for _, h := range forwardAuthHeadersCanon {
-			values := authResp.Header.Values(h)
-			if len(values) == 0 {
-				continue
-			}
-			out.Header.Del(h) // replace any existing values
-			for _, v := range values {
-				if v != "" {
-					out.Header.Add(h, v)
-				}
-			}
-		}
-		if debug {
-			log.Printf("[FORWARD] copied headers from AUTH → UPSTREAM: %s", strings.Join(forwardAuthHeadersCanon, ", "))
-		}
+	// 4a) Copy configured headers from the auth backend → upstream request (optional)
+	if len(forwardHeaders) > 0 {
+		applyForwardHeaders(out.Header, authHeaders, forwardHeaders)
+		log.Debug("forwarded auth headers to upstream", "headers", forwardHeaders)
 	}
 
-	if debug {
-		dump("PROXY → UPSTREAM", out, nil, "")
-	}
-
-	return a.upstream.RoundTrip(out)
+	return a.roundTripUpstream(out)
 }
 
-/* --------------------------------------------------------------------
-   Pretty text-logging helpers
--------------------------------------------------------------------- */
-
-func dump(tag string, req *http.Request, resp *http.Response, bodyPreview string) {
-	log.Println("------------------------------------------------------------")
-	log.Printf("[%s] %s %s", tag, req.Method, req.URL.RequestURI())
-
-	// request headers
-	for k, v := range req.Header {
-		log.Printf("  > %s: %s", k, strings.Join(v, ", "))
-	}
-	if bodyPreview != "" {
-		log.Printf("  > body (%d bytes): %q", len(bodyPreview), trimNL(bodyPreview))
-	}
-
-	if resp != nil {
-		log.Printf("  < %s", resp.Status)
-		for k, v := range resp.Header {
-			log.Printf("  < %s: %s", k, strings.Join(v, ", "))
-		}
-	}
+// roundTripUpstream performs the upstream round trip and records its
+// latency.
+func (a *authTransport) roundTripUpstream(out *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := a.upstream.RoundTrip(out)
+	upstreamLatency.Observe(time.Since(start).Seconds())
+	return resp, err
 }
 
-func trimNL(s string) string { return strings.ReplaceAll(s, "\n", "\\n") }
-
 /* --------------------------------------------------------------------
    Utility helpers
 -------------------------------------------------------------------- */
@@ -202,7 +181,7 @@ func cloneSubset(src http.Header) http.Header {
 	dst := http.Header{}
 	for k, v := range src {
 		switch http.CanonicalHeaderKey(k) {
-		case "Signature", "Signature-Date":
+		case "Signature", "Signature-Date", "X-Request-Id":
 			dst[k] = v
 		}
 	}
@@ -245,6 +224,24 @@ func envInt(k string, def int) int {
 	return def
 }
 
+func envDuration(k string, def time.Duration) time.Duration {
+	if v := os.Getenv(k); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return def
+}
+
+func envFloat(k string, def float64) float64 {
+	if v := os.Getenv(k); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return def
+}
+
 func envBool(k string, def bool) bool {
 	if v := os.Getenv(k); v != "" {
 		switch strings.ToLower(v) {
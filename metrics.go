@@ -0,0 +1,137 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+/* --------------------------------------------------------------------
+   Prometheus metrics + /healthz /readyz
+
+   Served off a second listener (METRICS_ADDR) so they aren't reachable
+   through the same auth-gated path as proxied traffic.
+-------------------------------------------------------------------- */
+
+var (
+	metricsAddr           = env("METRICS_ADDR", "")
+	readyFailureThreshold = envInt("READY_FAIL_THRESHOLD", 3) // consecutive auth-backend failures before /readyz trips
+)
+
+var (
+	authLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "auth_proxy_auth_duration_seconds",
+		Help:    "Latency of the auth backend call.",
+		Buckets: prometheus.DefBuckets,
+	})
+	upstreamLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "auth_proxy_upstream_duration_seconds",
+		Help:    "Latency of the upstream round trip.",
+		Buckets: prometheus.DefBuckets,
+	})
+	totalLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "auth_proxy_request_duration_seconds",
+		Help:    "Total latency of a proxied request, auth included.",
+		Buckets: prometheus.DefBuckets,
+	})
+	authDecisions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_proxy_auth_decisions_total",
+		Help: "Auth decisions by matched policy rule and resulting status code.",
+	}, []string{"rule", "status"})
+	inFlightRequests = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "auth_proxy_in_flight_requests",
+		Help: "Requests currently being proxied.",
+	})
+	// A GaugeFunc rather than a plain Gauge: authCache.len() is read
+	// fresh on every /metrics scrape, instead of only whenever something
+	// else (handleReadyz) happened to call .Set.
+	cacheSizeGauge = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "auth_proxy_auth_cache_entries",
+		Help: "Current number of entries in the auth decision cache.",
+	}, func() float64 {
+		if authCache == nil {
+			return 0
+		}
+		return float64(authCache.len())
+	})
+	cacheHitsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "auth_proxy_auth_cache_hits_total",
+		Help: "Auth decision cache hits.",
+	})
+	cacheMissTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "auth_proxy_auth_cache_misses_total",
+		Help: "Auth decision cache misses.",
+	})
+	authFailOpenTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "auth_proxy_auth_fail_open_total",
+		Help: "Requests let through by AUTH_FAIL_MODE=allow while the auth backend was unreachable/circuit-broken.",
+	})
+)
+
+var authBackendConsecutiveFailures atomic.Int64
+
+// recordAuthBackendResult tracks /readyz's only signal: whether the
+// auth backend was actually reachable. It must be driven by the real
+// transport outcome (circuit breaker trip, or the raw error/status from
+// the call itself), not by httpAuth.Validate's return value, since
+// AUTH_FAIL_MODE converts every unreachable-backend case into an
+// ordinary (err == nil) deny/allow decision before it gets there.
+func recordAuthBackendResult(reachable bool) {
+	if !reachable {
+		authBackendConsecutiveFailures.Add(1)
+		return
+	}
+	authBackendConsecutiveFailures.Store(0)
+}
+
+func ruleLabel(rule *compiledRule) string {
+	if rule == nil {
+		return "-"
+	}
+	return rule.Path
+}
+
+func recordAuthDecision(rule string, status int) {
+	authDecisions.WithLabelValues(rule, strconv.Itoa(status)).Inc()
+}
+
+// startMetricsServer runs the metrics/health listener in the
+// background when METRICS_ADDR is set. It blocks on ListenAndServe so
+// callers should invoke it via `go`.
+func startMetricsServer() {
+	if metricsAddr == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{}))
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/readyz", handleReadyz)
+
+	srv := &http.Server{
+		Addr:              metricsAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	logger.Info("metrics listener starting", "addr", metricsAddr)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		logger.Error("metrics listener stopped", "error", err)
+	}
+}
+
+func handleHealthz(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func handleReadyz(w http.ResponseWriter, _ *http.Request) {
+	if authBackendConsecutiveFailures.Load() >= int64(readyFailureThreshold) {
+		http.Error(w, "auth backend unreachable", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// TestCacheSizeGaugeReflectsCacheLen guards against a regression where
+// the cache-size gauge was only ever .Set from inside handleReadyz, so
+// a /metrics scrape could report a stale or zero value unless /readyz
+// happened to have been hit first. It's a GaugeFunc now, so every
+// Collect (i.e. every scrape) reads authCache.len() fresh.
+func TestCacheSizeGaugeReflectsCacheLen(t *testing.T) {
+	orig := authCache
+	defer func() { authCache = orig }()
+
+	authCache = newDecisionCache(10)
+	if got := testutil.ToFloat64(cacheSizeGauge); got != 0 {
+		t.Fatalf("gauge = %v, want 0 for an empty cache", got)
+	}
+
+	authCache.set("k", cacheEntry{status: 200})
+	if got := testutil.ToFloat64(cacheSizeGauge); got != 1 {
+		t.Fatalf("gauge = %v, want 1 after a cache write, without touching /readyz", got)
+	}
+
+	authCache = nil
+	if got := testutil.ToFloat64(cacheSizeGauge); got != 0 {
+		t.Fatalf("gauge = %v, want 0 when caching is disabled", got)
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"syscall"
+
+	"gopkg.in/yaml.v3"
+)
+
+/* --------------------------------------------------------------------
+   Per-route auth policy (AUTH_POLICY_FILE)
+
+   Replaces the single AUTH_INCLUDE_REGEX all-or-nothing switch with a
+   list of rules, evaluated first-match, each of which can pick its own
+   auth backend, required headers/claims, and which headers get
+   forwarded to upstream. Reloadable at runtime via SIGHUP.
+-------------------------------------------------------------------- */
+
+// PolicyRule is one entry of the AUTH_POLICY_FILE document.
+type PolicyRule struct {
+	Path            string            `yaml:"path" json:"path"`
+	Methods         []string          `yaml:"methods" json:"methods"`
+	AuthBackend     string            `yaml:"auth_backend" json:"auth_backend"`
+	ForwardHeaders  []string          `yaml:"forward_headers" json:"forward_headers"`
+	RequiredClaims  map[string]string `yaml:"required_claims" json:"required_claims"`
+	RequiredHeaders map[string]string `yaml:"required_headers" json:"required_headers"`
+	Deny            bool              `yaml:"deny" json:"deny"`
+}
+
+type policyDocument struct {
+	Rules []PolicyRule `yaml:"rules" json:"rules"`
+}
+
+// compiledRule is a PolicyRule with its path pattern compiled and its
+// auth backend resolved, ready to be matched against requests.
+type compiledRule struct {
+	PolicyRule
+	re             *regexp.Regexp
+	methods        map[string]struct{} // empty → any method
+	backend        Auth                // nil when AuthBackend == "" (use the default backend)
+	forwardHeaders []string            // canonicalized; empty → use the global AUTH_FORWARD_AUTH_HEADERS
+}
+
+func (c *compiledRule) matches(r *http.Request) bool {
+	if !c.re.MatchString(r.URL.Path) {
+		return false
+	}
+	if len(c.methods) == 0 {
+		return true
+	}
+	_, ok := c.methods[r.Method]
+	return ok
+}
+
+// Policy is an ordered, first-match list of compiled rules.
+type Policy struct {
+	rules []*compiledRule
+}
+
+func (p *Policy) match(r *http.Request) *compiledRule {
+	for _, rule := range p.rules {
+		if rule.matches(r) {
+			return rule
+		}
+	}
+	return nil
+}
+
+var (
+	policyFilePath = env("AUTH_POLICY_FILE", "") // empty → legacy AUTH_INCLUDE_REGEX mode
+	policy         atomic.Pointer[Policy]        // nil when policyFilePath == ""
+)
+
+func init() {
+	if strings.TrimSpace(policyFilePath) == "" {
+		return
+	}
+
+	if err := reloadPolicy(); err != nil {
+		log.Fatalf("loading AUTH_POLICY_FILE %q: %v", policyFilePath, err)
+	}
+
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	go func() {
+		for range sighup {
+			if err := reloadPolicy(); err != nil {
+				logger.Warn("policy reload failed, keeping previous policy", "path", policyFilePath, "error", err)
+				continue
+			}
+			logger.Info("policy reloaded", "path", policyFilePath)
+		}
+	}()
+}
+
+func reloadPolicy() error {
+	p, err := loadPolicy(policyFilePath)
+	if err != nil {
+		return err
+	}
+	policy.Store(p)
+	return nil
+}
+
+func loadPolicy(path string) (*Policy, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc policyDocument
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(raw, &doc)
+	case ".json":
+		err = json.Unmarshal(raw, &doc)
+	default:
+		return nil, fmt.Errorf("unsupported policy file extension %q (want .yaml/.yml/.json)", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	rules := make([]*compiledRule, 0, len(doc.Rules))
+	for i, r := range doc.Rules {
+		c, err := compileRule(r)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d (%q): %w", i, r.Path, err)
+		}
+		rules = append(rules, c)
+	}
+	return &Policy{rules: rules}, nil
+}
+
+func compileRule(r PolicyRule) (*compiledRule, error) {
+	re, err := compilePathPattern(r.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var backend Auth
+	if strings.TrimSpace(r.AuthBackend) != "" {
+		backend, err = newAuth(r.AuthBackend)
+		if err != nil {
+			return nil, fmt.Errorf("auth_backend: %w", err)
+		}
+	}
+
+	methods := make(map[string]struct{}, len(r.Methods))
+	for _, m := range r.Methods {
+		methods[strings.ToUpper(strings.TrimSpace(m))] = struct{}{}
+	}
+
+	return &compiledRule{
+		PolicyRule:     r,
+		re:             re,
+		methods:        methods,
+		backend:        backend,
+		forwardHeaders: parseHeaderList(strings.Join(r.ForwardHeaders, ",")),
+	}, nil
+}
+
+/* --------------------------------------------------------------------
+   wiring into authTransport.RoundTrip
+-------------------------------------------------------------------- */
+
+// selectAuth picks the auth backend, the set of headers to forward,
+// and the matched rule (if any) for r. bypass is true when the request
+// should skip auth entirely, which happens when no AUTH_POLICY_FILE is
+// configured and AUTH_INCLUDE_REGEX doesn't match, or when a policy is
+// configured but none of its rules match r.
+func selectAuth(r *http.Request) (backend Auth, forwardHeaders []string, rule *compiledRule, bypass bool) {
+	p := policy.Load()
+	if p == nil {
+		if !authIncludeRE.MatchString(r.URL.Path) {
+			return nil, nil, nil, true
+		}
+		return auth, forwardAuthHeadersCanon, nil, false
+	}
+
+	m := p.match(r)
+	if m == nil {
+		return nil, nil, nil, true
+	}
+
+	backend = m.backend
+	if backend == nil {
+		backend = auth
+	}
+	forwardHeaders = m.forwardHeaders
+	if len(forwardHeaders) == 0 {
+		forwardHeaders = forwardAuthHeadersCanon
+	}
+	return backend, forwardHeaders, m, false
+}
+
+func requiredHeadersSatisfied(r *http.Request, want map[string]string) bool {
+	for h, v := range want {
+		if r.Header.Get(h) != v {
+			return false
+		}
+	}
+	return true
+}
+
+// requiredClaimsSatisfied checks claims surfaced by the auth backend as
+// X-Claim-<Name> headers (this is how the jwt:// backend exposes them)
+// against the rule's required_claims.
+func requiredClaimsSatisfied(authHeaders http.Header, want map[string]string) bool {
+	for claim, v := range want {
+		if authHeaders.Get("X-Claim-"+claim) != v {
+			return false
+		}
+	}
+	return true
+}
+
+func denyResponse(r *http.Request, status int) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Status:     http.StatusText(status),
+		Proto:      "HTTP/1.1", ProtoMajor: 1, ProtoMinor: 1,
+		Request: r,
+		Header:  http.Header{},
+		Body:    http.NoBody,
+	}
+}
+
+// compilePathPattern accepts either a regexp or a shell-style glob
+// (`*` / `?`). A pattern containing any of ^$()[]|\ is compiled as a
+// regexp as-is, so it is anchored only where it anchors itself; any
+// other pattern is a glob and is anchored at both ends.
+func compilePathPattern(pattern string) (*regexp.Regexp, error) {
+	if strings.ContainsAny(pattern, "^$()[]|\\") {
+		return regexp.Compile(pattern)
+	}
+
+	var b strings.Builder
+	b.WriteByte('^')
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteByte('$')
+	return regexp.Compile(b.String())
+}
@@ -0,0 +1,68 @@
+package main
+
+import "testing"
+
+func TestCompilePathPattern(t *testing.T) {
+	cases := []struct {
+		name    string
+		pattern string
+		match   []string
+		nomatch []string
+		wantErr bool
+	}{
+		{
+			name:    "glob star",
+			pattern: "/public/*",
+			match:   []string{"/public/", "/public/foo", "/public/foo/bar"},
+			nomatch: []string{"/public", "/private/foo"},
+		},
+		{
+			name:    "glob question mark",
+			pattern: "/v?/health",
+			match:   []string{"/v1/health", "/v2/health"},
+			nomatch: []string{"/v10/health", "/v1/healthz"},
+		},
+		{
+			name:    "literal glob has no wildcard meaning",
+			pattern: "/healthz",
+			match:   []string{"/healthz"},
+			nomatch: []string{"/healthzz", "/v1/healthz"},
+		},
+		{
+			name:    "already a regexp is used as-is (anchored)",
+			pattern: "^/admin(?:/|$)",
+			match:   []string{"/admin", "/admin/users"},
+			nomatch: []string{"/adminx"},
+		},
+		{
+			name:    "invalid regexp",
+			pattern: "/admin(",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			re, err := compilePathPattern(tc.pattern)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("compilePathPattern(%q): expected error, got none", tc.pattern)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("compilePathPattern(%q): %v", tc.pattern, err)
+			}
+			for _, p := range tc.match {
+				if !re.MatchString(p) {
+					t.Errorf("pattern %q: expected %q to match", tc.pattern, p)
+				}
+			}
+			for _, p := range tc.nomatch {
+				if re.MatchString(p) {
+					t.Errorf("pattern %q: expected %q not to match", tc.pattern, p)
+				}
+			}
+		})
+	}
+}
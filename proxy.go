@@ -0,0 +1,211 @@
+package main
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+/* --------------------------------------------------------------------
+   WebSocket upgrades and hop-by-hop header hygiene.
+
+   httputil.ReverseProxy's RoundTripper-based Transport above can only
+   produce a complete *http.Response, which breaks `Connection: Upgrade`
+   requests (WebSocket, etc.) - there is no response to buffer, the
+   connection becomes a raw bidirectional tunnel. Those requests are
+   instead hijacked here, authorized the same way as any other request,
+   and spliced directly to the upstream TCP connection.
+-------------------------------------------------------------------- */
+
+// authDerivedHeaderPrefixes are the header-name prefixes the pluggable
+// auth backends use to surface verified identity to upstream:
+// X-Auth-User (basicfile://), X-Auth-Subject and X-Claim-<name>
+// (jwt://). A client-supplied copy of any of these must never reach
+// upstream un-vetted, regardless of whether forward_headers is
+// configured to relay it.
+var authDerivedHeaderPrefixes = []string{"X-Auth-", "X-Claim-"}
+
+// stripAuthDerivedHeaders removes any inbound header an auth backend
+// uses to surface verified identity, so a request can't spoof its own
+// X-Auth-User/X-Claim-role and have it forwarded to upstream as if the
+// auth backend had vouched for it. Applied unconditionally, before auth
+// even runs, since a bypassed route forwards r.Header just the same.
+func stripAuthDerivedHeaders(h http.Header) {
+	for name := range h {
+		canon := http.CanonicalHeaderKey(name)
+		for _, prefix := range authDerivedHeaderPrefixes {
+			if strings.HasPrefix(canon, prefix) {
+				h.Del(name)
+				break
+			}
+		}
+	}
+}
+
+// hopByHopHeaders are always stripped before a request leaves this hop,
+// regardless of what Connection lists (RFC 7230 §6.1).
+var hopByHopHeaders = []string{
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"TE",
+	"Trailer",
+	"Transfer-Encoding",
+}
+
+// stripHopByHop removes the standard hop-by-hop headers plus any
+// headers the Connection header itself names (including Connection and
+// Upgrade). Use for the auth request and for plain, non-upgrade
+// requests forwarded to upstream.
+func stripHopByHop(h http.Header) {
+	for _, v := range h.Values("Connection") {
+		for _, token := range strings.Split(v, ",") {
+			if token = strings.TrimSpace(token); token != "" {
+				h.Del(token)
+			}
+		}
+	}
+	h.Del("Connection")
+	h.Del("Upgrade")
+	for _, hh := range hopByHopHeaders {
+		h.Del(hh)
+	}
+}
+
+// applyForwardHeaders copies the named headers from src onto dst,
+// replacing any existing values (used to splice auth-backend-derived
+// headers, e.g. X-Auth-User, into the request going to upstream).
+func applyForwardHeaders(dst, src http.Header, names []string) {
+	for _, h := range names {
+		values := src.Values(h)
+		if len(values) == 0 {
+			continue
+		}
+		dst.Del(h)
+		for _, v := range values {
+			if v != "" {
+				dst.Add(h, v)
+			}
+		}
+	}
+}
+
+func isUpgradeRequest(r *http.Request) bool {
+	return headerTokenContains(r.Header, "Connection", "upgrade") && r.Header.Get("Upgrade") != ""
+}
+
+func headerTokenContains(h http.Header, name, want string) bool {
+	for _, v := range h.Values(name) {
+		for _, tok := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(tok), want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// handleUpgrade authorizes r exactly like authTransport.RoundTrip, then
+// hijacks the client connection and splices it to a fresh upstream TCP
+// connection so the upgrade handshake (and everything after it) passes
+// through untouched.
+func handleUpgrade(w http.ResponseWriter, r *http.Request) {
+	requestID(r)
+	stripAuthDerivedHeaders(r.Header)
+	backend, forwardHeaders, rule, bypass := selectAuth(r)
+
+	if !bypass {
+		if rule != nil && (rule.Deny || !requiredHeadersSatisfied(r, rule.RequiredHeaders)) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		authHeaders, status, err := validateAuth(backend, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		if status == http.StatusOK && rule != nil && !requiredClaimsSatisfied(authHeaders, rule.RequiredClaims) {
+			status = http.StatusForbidden
+		}
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		applyForwardHeaders(r.Header, authHeaders, forwardHeaders)
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "upgrade not supported", http.StatusInternalServerError)
+		return
+	}
+
+	upstreamConn, err := dialUpstream()
+	if err != nil {
+		http.Error(w, "upstream unreachable", http.StatusBadGateway)
+		return
+	}
+
+	// Only the always-hop-by-hop set is stripped here: Connection and
+	// Upgrade themselves must reach upstream intact for it to complete
+	// the handshake.
+	for _, hh := range hopByHopHeaders {
+		r.Header.Del(hh)
+	}
+
+	if err := r.Write(upstreamConn); err != nil {
+		upstreamConn.Close()
+		logger.Warn("writing request to upstream failed", "error", err)
+		return
+	}
+
+	clientConn, clientBuf, err := hijacker.Hijack()
+	if err != nil {
+		upstreamConn.Close()
+		logger.Warn("hijack failed", "error", err)
+		return
+	}
+
+	if n := clientBuf.Reader.Buffered(); n > 0 {
+		if _, err := io.CopyN(upstreamConn, clientBuf.Reader, int64(n)); err != nil {
+			logger.Warn("draining buffered client bytes failed", "error", err)
+		}
+	}
+
+	splice(clientConn, upstreamConn)
+}
+
+// dialUpstream opens the raw TCP (or TLS) connection an upgraded
+// request is spliced onto, using the same client cert/ServerName/
+// insecure-skip-verify config as the ordinary upstream transport (see
+// upstreamTLSConfig in transport.go) so an upgrade isn't held to a lower
+// bar than a plain request just because it bypasses http.Transport.
+// Its ALPN offers only http/1.1, where the ordinary transport also
+// offers h2.
+func dialUpstream() (net.Conn, error) {
+	addr := upstreamHostPort()
+	if upstreamURL.Scheme == "https" {
+		return tls.Dial("tcp", addr, upstreamTLSConfig("http/1.1"))
+	}
+	return net.Dial("tcp", addr)
+}
+
+// splice pumps bytes in both directions until either side closes, then
+// closes the other.
+func splice(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(a, b)
+		a.Close()
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(b, a)
+		b.Close()
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+/* --------------------------------------------------------------------
+   Retries, timeouts and a per-endpoint circuit breaker around the auth
+   call. A single transient failure (or a 5xx) used to be returned
+   straight to the client; now it's retried a bounded number of times
+   with jittered exponential backoff, and a flaky endpoint trips a
+   breaker so every subsequent request short-circuits to AUTH_FAIL_MODE
+   instead of adding load to (or waiting on) a struggling service.
+-------------------------------------------------------------------- */
+
+var (
+	authTimeout      = envDuration("AUTH_TIMEOUT", 5*time.Second)
+	authRetries      = envInt("AUTH_RETRIES", 2)
+	authRetryBackoff = envDuration("AUTH_RETRY_BACKOFF", 100*time.Millisecond)
+	authFailMode     = env("AUTH_FAIL_MODE", "deny") // deny (503) | allow (fail-open)
+
+	cbWindow       = envDuration("CB_WINDOW", 10*time.Second)
+	cbMinRequests  = envInt("CB_MIN_REQUESTS", 10)
+	cbFailureRatio = envFloat("CB_FAILURE_RATIO", 0.5)
+	cbCooldown     = envDuration("CB_COOLDOWN", 30*time.Second)
+)
+
+const (
+	cbClosed = iota
+	cbOpen
+	cbHalfOpen
+)
+
+// circuitBreaker is a classic closed/open/half-open breaker over a
+// rolling request window: once failureRatio of the last window's
+// requests (after minRequests have been seen) failed, it opens and
+// rejects everything until cooldown elapses, then lets exactly one
+// probe through (half-open) to decide whether to close again.
+type circuitBreaker struct {
+	mu       sync.Mutex
+	state    int
+	windowAt time.Time
+	reqs     int
+	fails    int
+	openedAt time.Time
+
+	window       time.Duration
+	minRequests  int
+	failureRatio float64
+	cooldown     time.Duration
+}
+
+func newCircuitBreaker(window time.Duration, minRequests int, failureRatio float64, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		window:       window,
+		minRequests:  minRequests,
+		failureRatio: failureRatio,
+		cooldown:     cooldown,
+		windowAt:     time.Now(),
+	}
+}
+
+// Allow reports whether a call should be attempted right now. Only the
+// single call that flips the breaker from open to half-open is let
+// through as the probe; every other caller sees the half-open state
+// already set and is rejected until Record resolves it back to closed
+// or open, so a recovering backend never sees more than one in-flight
+// probe at a time.
+func (cb *circuitBreaker) Allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case cbClosed:
+		return true
+	case cbHalfOpen:
+		return false
+	default: // cbOpen
+		if time.Since(cb.openedAt) < cb.cooldown {
+			return false
+		}
+		cb.state = cbHalfOpen
+		return true
+	}
+}
+
+// Record reports the outcome of a call permitted by Allow.
+func (cb *circuitBreaker) Record(success bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == cbHalfOpen {
+		if success {
+			cb.state, cb.reqs, cb.fails, cb.windowAt = cbClosed, 0, 0, time.Now()
+		} else {
+			cb.state, cb.openedAt = cbOpen, time.Now()
+		}
+		return
+	}
+
+	if time.Since(cb.windowAt) > cb.window {
+		cb.reqs, cb.fails, cb.windowAt = 0, 0, time.Now()
+	}
+	cb.reqs++
+	if !success {
+		cb.fails++
+	}
+	if cb.reqs >= cb.minRequests && float64(cb.fails)/float64(cb.reqs) >= cb.failureRatio {
+		cb.state, cb.openedAt = cbOpen, time.Now()
+	}
+}
+
+// retryable reports whether a failed auth call is worth retrying: only
+// network-level errors and 5xx responses are treated as transient.
+func retryable(err error, status int) bool {
+	return err != nil || status >= 500
+}
+
+// retryDelay returns a jittered exponential backoff for the given
+// (1-indexed) retry attempt.
+func retryDelay(base time.Duration, attempt int) time.Duration {
+	d := base << uint(attempt-1)
+	return d/2 + time.Duration(rand.Int63n(int64(d)/2+1))
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerOpensOnFailureRatio(t *testing.T) {
+	cb := newCircuitBreaker(time.Minute, 2, 0.5, time.Hour)
+
+	if !cb.Allow() {
+		t.Fatal("expected a fresh breaker to be closed (allow)")
+	}
+
+	cb.Record(true)
+	cb.Record(false)
+	if cb.state != cbOpen {
+		t.Fatalf("state = %d, want cbOpen after failureRatio reached", cb.state)
+	}
+	if cb.Allow() {
+		t.Fatal("expected an open breaker within its cooldown to reject")
+	}
+}
+
+func TestCircuitBreakerHalfOpenAdmitsOneProbe(t *testing.T) {
+	cb := newCircuitBreaker(time.Minute, 1, 0.5, 10*time.Millisecond)
+
+	cb.Record(false) // trips open (1 request, 100% failures >= 50%)
+	if cb.state != cbOpen {
+		t.Fatalf("state = %d, want cbOpen", cb.state)
+	}
+
+	time.Sleep(15 * time.Millisecond) // let the cooldown elapse
+
+	if !cb.Allow() {
+		t.Fatal("expected the first call after cooldown to be admitted as the probe")
+	}
+	if cb.state != cbHalfOpen {
+		t.Fatalf("state = %d, want cbHalfOpen after the probe is admitted", cb.state)
+	}
+
+	for i := 0; i < 5; i++ {
+		if cb.Allow() {
+			t.Fatal("expected concurrent callers to be rejected while a probe is already in flight")
+		}
+	}
+}
+
+func TestCircuitBreakerHalfOpenSuccessCloses(t *testing.T) {
+	cb := newCircuitBreaker(time.Minute, 1, 0.5, 10*time.Millisecond)
+	cb.Record(false)
+	time.Sleep(15 * time.Millisecond)
+
+	if !cb.Allow() {
+		t.Fatal("expected the probe to be admitted")
+	}
+	cb.Record(true)
+
+	if cb.state != cbClosed {
+		t.Fatalf("state = %d, want cbClosed after a successful probe", cb.state)
+	}
+	if !cb.Allow() {
+		t.Fatal("expected a closed breaker to admit calls")
+	}
+}
+
+func TestCircuitBreakerHalfOpenFailureReopens(t *testing.T) {
+	cb := newCircuitBreaker(time.Minute, 1, 0.5, 10*time.Millisecond)
+	cb.Record(false)
+	time.Sleep(15 * time.Millisecond)
+
+	if !cb.Allow() {
+		t.Fatal("expected the probe to be admitted")
+	}
+	cb.Record(false)
+
+	if cb.state != cbOpen {
+		t.Fatalf("state = %d, want cbOpen after a failed probe", cb.state)
+	}
+	if cb.Allow() {
+		t.Fatal("expected the breaker to reject again immediately after re-opening")
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	cases := []struct {
+		name   string
+		err    error
+		status int
+		want   bool
+	}{
+		{"network error", errTest{}, 0, true},
+		{"5xx", nil, 503, true},
+		{"2xx", nil, 200, false},
+		{"4xx", nil, 404, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := retryable(tc.err, tc.status); got != tc.want {
+				t.Errorf("retryable(%v, %d) = %v, want %v", tc.err, tc.status, got, tc.want)
+			}
+		})
+	}
+}
+
+type errTest struct{}
+
+func (errTest) Error() string { return "boom" }
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"net"
+	"net/http"
+
+	"golang.org/x/net/http2"
+)
+
+/* --------------------------------------------------------------------
+   Upstream transport - TLS verification/client certs and HTTP/2
+   (including cleartext h2c) towards UPSTREAM_ADDR.
+-------------------------------------------------------------------- */
+
+var (
+	upstreamTLSInsecure = envBool("UPSTREAM_TLS_INSECURE", false)
+	upstreamTLSCertFile = env("UPSTREAM_TLS_CERT_FILE", "")
+	upstreamTLSKeyFile  = env("UPSTREAM_TLS_KEY_FILE", "")
+	upstreamH2C         = envBool("UPSTREAM_H2C", false)
+)
+
+// upstreamTLSConfig builds the tls.Config used for every TLS connection
+// to UPSTREAM_ADDR, whether initiated by the ordinary http.Transport
+// below or by dialUpstream's hijacked-tunnel path in proxy.go: the
+// configured client cert, insecure-skip-verify, and an explicit
+// ServerName (the host without its port) rather than leaving it to be
+// derived wherever TLS happens to be dialed from.
+func upstreamTLSConfig(nextProtos ...string) *tls.Config {
+	host, _, err := net.SplitHostPort(upstreamURL.Host)
+	if err != nil {
+		host = upstreamURL.Host
+	}
+
+	cfg := &tls.Config{
+		InsecureSkipVerify: upstreamTLSInsecure,
+		ServerName:         host,
+		NextProtos:         nextProtos,
+	}
+	if upstreamTLSCertFile != "" && upstreamTLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(upstreamTLSCertFile, upstreamTLSKeyFile)
+		if err != nil {
+			log.Fatalf("loading UPSTREAM_TLS_CERT_FILE/UPSTREAM_TLS_KEY_FILE: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg
+}
+
+// upstreamHostPort returns UPSTREAM_ADDR's host:port, defaulting the
+// port by scheme when UPSTREAM_ADDR didn't specify one explicitly (net
+// and tls's Dial, unlike http.Transport, require one).
+func upstreamHostPort() string {
+	if _, _, err := net.SplitHostPort(upstreamURL.Host); err == nil {
+		return upstreamURL.Host
+	}
+	port := "80"
+	if upstreamURL.Scheme == "https" {
+		port = "443"
+	}
+	return net.JoinHostPort(upstreamURL.Host, port)
+}
+
+// newUpstreamTransport builds the RoundTripper used to reach
+// UPSTREAM_ADDR for ordinary (non-upgrade) requests.
+func newUpstreamTransport() http.RoundTripper {
+	// h2c: HTTP/2 over a plaintext TCP connection to the upstream.
+	if upstreamH2C && upstreamURL.Scheme == "http" {
+		return &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(_ context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return net.Dial(network, addr)
+			},
+		}
+	}
+
+	var nextProtos []string
+	if upstreamURL.Scheme == "https" {
+		nextProtos = []string{"h2", "http/1.1"}
+	}
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = upstreamTLSConfig(nextProtos...)
+	if upstreamURL.Scheme == "https" {
+		if err := http2.ConfigureTransport(t); err != nil {
+			logger.Warn("could not enable HTTP/2 to upstream", "error", err)
+		}
+	}
+	return t
+}